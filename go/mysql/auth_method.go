@@ -0,0 +1,311 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mysql implements pieces of the MySQL client protocol that are
+// shared by the various tablet dialers, starting with authentication
+// plugin negotiation.
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	log "github.com/golang/glog"
+)
+
+// Status bytes of a caching_sha2_password authentication continuation, as
+// documented in the MySQL internals manual. The server sends the fast auth
+// success and full auth required bytes; the client sends the public key
+// request byte.
+const (
+	cachingSha2FastAuthSuccess  = 0x03
+	cachingSha2FullAuthRequired = 0x04
+	cachingSha2RequestPublicKey = 0x02
+)
+
+// AuthMethod implements the client side of one MySQL authentication
+// plugin. A TabletDialer obtains one via GetAuthMethod, by plugin name,
+// and drives it through the handshake (see Negotiate). Nothing in this
+// package reads the -tablet_auth_method flag; the plugin name always comes
+// from the caller or from a server AuthSwitchRequest.
+// InitialResponse is called once, with the salt from the initial
+// handshake packet, to produce the response bytes sent as part of the
+// HandshakeResponse packet. If the server later sends an
+// AuthSwitchRequest naming this same plugin, or further auth data for it,
+// each subsequent packet is passed to Continue until it returns a nil
+// packet, meaning the plugin considers the exchange done.
+type AuthMethod interface {
+	// Name returns the plugin name as used on the wire, e.g.
+	// "mysql_native_password".
+	Name() string
+
+	// InitialResponse computes the auth response bytes to send given the
+	// salt from the server's handshake (or AuthSwitchRequest) packet.
+	InitialResponse(salt []byte, password string) ([]byte, error)
+
+	// Continue is called with each additional packet the server sends
+	// during the exchange (for instance a public key request, or the
+	// caching_sha2_password fast/full auth status byte). It returns the
+	// bytes to send back, or a nil slice if no further response is
+	// needed and the plugin considers authentication complete.
+	Continue(pkt []byte) ([]byte, error)
+}
+
+var authMethods = make(map[string]func(tls bool) AuthMethod)
+
+// RegisterAuthMethod is meant to be used by AuthMethod implementations to
+// self register under their plugin name. tls is passed through from
+// GetAuthMethod so a plugin can tell whether it's allowed to fall back to
+// sending the password in the clear.
+func RegisterAuthMethod(name string, factory func(tls bool) AuthMethod) {
+	if _, ok := authMethods[name]; ok {
+		log.Fatalf("AuthMethod %s already exists", name)
+	}
+	authMethods[name] = factory
+}
+
+// GetAuthMethod returns a fresh instance of the registered AuthMethod with
+// the given plugin name, as passed in by the caller or named by a server
+// AuthSwitchRequest. tls should be true when the underlying connection is
+// already protected by TLS, letting plugins that would otherwise need the
+// RSA public key exchange send the password in the clear instead.
+func GetAuthMethod(name string, tls bool) (AuthMethod, error) {
+	factory, ok := authMethods[name]
+	if !ok {
+		return nil, fmt.Errorf("mysql: no AuthMethod registered for plugin %q", name)
+	}
+	return factory(tls), nil
+}
+
+func init() {
+	RegisterAuthMethod("mysql_native_password", func(tls bool) AuthMethod { return &nativePassword{} })
+	RegisterAuthMethod("caching_sha2_password", func(tls bool) AuthMethod { return &cachingSha2Password{usingTLS: tls} })
+	RegisterAuthMethod("sha256_password", func(tls bool) AuthMethod { return &sha256Password{usingTLS: tls} })
+}
+
+// nativePassword implements the mysql_native_password plugin.
+type nativePassword struct {
+	salt     []byte
+	password string
+}
+
+// Name is part of the AuthMethod interface.
+func (a *nativePassword) Name() string { return "mysql_native_password" }
+
+// InitialResponse is part of the AuthMethod interface.
+func (a *nativePassword) InitialResponse(salt []byte, password string) ([]byte, error) {
+	a.salt = salt
+	a.password = password
+	if password == "" {
+		return nil, nil
+	}
+	return scrambleNative(salt, password), nil
+}
+
+// Continue is part of the AuthMethod interface. mysql_native_password is a
+// single round-trip plugin, so there is nothing further to do.
+func (a *nativePassword) Continue(pkt []byte) ([]byte, error) {
+	return nil, nil
+}
+
+// scrambleNative computes the mysql_native_password response:
+// XOR(SHA1(password), SHA1(salt + SHA1(SHA1(password)))).
+func scrambleNative(salt []byte, password string) []byte {
+	pwHash := sha1.Sum([]byte(password))
+	pwHashHash := sha1.Sum(pwHash[:])
+
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(pwHashHash[:])
+	scramble := h.Sum(nil)
+
+	for i := range scramble {
+		scramble[i] ^= pwHash[i]
+	}
+	return scramble
+}
+
+// scrambleSha256 computes generate_sha256_scramble(), as used by
+// caching_sha2_password and sha256_password. Unlike scrambleNative, the
+// hash-of-hash is concatenated before the salt, not after.
+func scrambleSha256(salt []byte, password string) []byte {
+	pwHash := sha256.Sum256([]byte(password))
+	pwHashHash := sha256.Sum256(pwHash[:])
+
+	h := sha256.New()
+	h.Write(pwHashHash[:])
+	h.Write(salt)
+	scramble := h.Sum(nil)
+
+	for i := range scramble {
+		scramble[i] ^= pwHash[i]
+	}
+	return scramble
+}
+
+// cachingSha2Password implements the caching_sha2_password plugin
+// introduced in MySQL 8.0, including the fast-auth-success / full-auth
+// round trip and the RSA public key exchange used to send the password
+// encrypted when the connection is not already protected by TLS.
+type cachingSha2Password struct {
+	salt     []byte
+	password string
+
+	// usingTLS should be set by the dialer when the underlying connection
+	// is already protected by TLS, in which case the password can be sent
+	// as plaintext instead of going through the RSA exchange.
+	usingTLS bool
+
+	// awaitingPubKey is true after we've sent the "request public key"
+	// byte (0x02) and are waiting for the server to reply with its key.
+	awaitingPubKey bool
+
+	// requestedPubKeyTwice guards against looping forever if the server
+	// keeps sending an empty pubkey packet.
+	requestedPubKeyTwice bool
+}
+
+// Name is part of the AuthMethod interface.
+func (a *cachingSha2Password) Name() string { return "caching_sha2_password" }
+
+// InitialResponse is part of the AuthMethod interface.
+func (a *cachingSha2Password) InitialResponse(salt []byte, password string) ([]byte, error) {
+	a.salt = salt
+	a.password = password
+	if password == "" {
+		return nil, nil
+	}
+	return scrambleSha256(salt, password), nil
+}
+
+// Continue is part of the AuthMethod interface. It handles the
+// fast-auth-success/full-auth status byte the server sends after the
+// scrambled response, and, when full authentication is required over a
+// plaintext connection, the RSA public key exchange.
+func (a *cachingSha2Password) Continue(pkt []byte) ([]byte, error) {
+	if a.awaitingPubKey {
+		resp, retry, err := a.tryEncryptWithServerKey(pkt)
+		if !retry {
+			a.awaitingPubKey = false
+		}
+		return resp, err
+	}
+
+	if len(pkt) == 0 {
+		return nil, fmt.Errorf("mysql: empty caching_sha2_password continuation packet")
+	}
+
+	switch pkt[0] {
+	case cachingSha2FastAuthSuccess:
+		// The server accepted the cached scramble; nothing more to send.
+		return nil, nil
+	case cachingSha2FullAuthRequired:
+		if a.usingTLS {
+			// Over TLS we can just send the password in the clear,
+			// NUL-terminated.
+			return append([]byte(a.password), 0), nil
+		}
+		// Without TLS, ask the server for its RSA public key with 0x02.
+		a.awaitingPubKey = true
+		return []byte{cachingSha2RequestPublicKey}, nil
+	default:
+		return nil, fmt.Errorf("mysql: unexpected caching_sha2_password status byte 0x%x", pkt[0])
+	}
+}
+
+// tryEncryptWithServerKey wraps encryptWithServerKey with the "server sent
+// an empty pubkey; request one with 0x02" retry: a server that does not
+// yet have a cached public key, or whose
+// --caching_sha2_password_public_key_path is unset, may send an empty
+// packet here, in which case we ask for one again instead of treating it
+// as a protocol error. retry is true when the caller should send resp and
+// come back through this same path with the next packet.
+func (a *cachingSha2Password) tryEncryptWithServerKey(pkt []byte) (resp []byte, retry bool, err error) {
+	if len(pkt) == 0 {
+		if a.requestedPubKeyTwice {
+			return nil, false, fmt.Errorf("mysql: server repeatedly sent an empty pubkey")
+		}
+		a.requestedPubKeyTwice = true
+		return []byte{cachingSha2RequestPublicKey}, true, nil
+	}
+	resp, err = a.encryptWithServerKey(pkt)
+	return resp, false, err
+}
+
+// encryptWithServerKey parses the PEM-encoded RSA public key the server
+// sent in response to our 0x02 request, and returns the password
+// encrypted with RSA-OAEP, XORed against the salt as MySQL requires.
+func (a *cachingSha2Password) encryptWithServerKey(pkt []byte) ([]byte, error) {
+	block, _ := pem.Decode(pkt)
+	if block == nil {
+		return nil, fmt.Errorf("mysql: could not decode server RSA public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not parse server RSA public key: %v", err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("mysql: server public key is not RSA")
+	}
+
+	// XOR the NUL-terminated password with the salt, repeating the salt
+	// as needed, before encrypting, as required by the protocol.
+	plain := append([]byte(a.password), 0)
+	for i := range plain {
+		plain[i] ^= a.salt[i%len(a.salt)]
+	}
+
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+}
+
+// sha256Password implements the older sha256_password plugin. It always
+// goes through the RSA public key exchange (or plaintext-over-TLS) on
+// every connection, unlike caching_sha2_password which can skip it once
+// the server has cached a fast-auth hash for the account.
+type sha256Password struct {
+	salt     []byte
+	password string
+	usingTLS bool
+
+	// keyExchange carries the RSA public-key-request retry state across
+	// Continue calls; sha256_password reuses cachingSha2Password's
+	// exchange since the two plugins share it verbatim.
+	keyExchange *cachingSha2Password
+}
+
+// Name is part of the AuthMethod interface.
+func (a *sha256Password) Name() string { return "sha256_password" }
+
+// InitialResponse is part of the AuthMethod interface. sha256_password
+// always requests the server's public key (or sends plaintext over TLS)
+// rather than offering a pre-computed scramble.
+func (a *sha256Password) InitialResponse(salt []byte, password string) ([]byte, error) {
+	a.salt = salt
+	a.password = password
+	if password == "" {
+		return []byte{0}, nil
+	}
+	if a.usingTLS {
+		return append([]byte(password), 0), nil
+	}
+	a.keyExchange = &cachingSha2Password{salt: salt, password: password}
+	return []byte{cachingSha2RequestPublicKey}, nil
+}
+
+// Continue is part of the AuthMethod interface; it performs the RSA-OAEP
+// exchange once the server replies with its public key, including the
+// "empty pubkey, ask again with 0x02" retry.
+func (a *sha256Password) Continue(pkt []byte) ([]byte, error) {
+	if a.usingTLS || a.password == "" {
+		return nil, nil
+	}
+	resp, _, err := a.keyExchange.tryEncryptWithServerKey(pkt)
+	return resp, err
+}
@@ -0,0 +1,190 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Status/marker bytes used in the packets exchanged while authenticating,
+// as documented in the MySQL internals manual.
+const (
+	packetOK           = 0x00
+	packetAuthMoreData = 0x01
+	packetAuthSwitch   = 0xfe
+	packetErr          = 0xff
+)
+
+// readPacket reads one MySQL protocol packet: a 3-byte little-endian
+// length, a 1-byte sequence number, then that many payload bytes.
+func readPacket(r io.Reader) (payload []byte, seq byte, err error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	return payload, header[3], nil
+}
+
+// writePacket writes payload as one MySQL protocol packet with the given
+// sequence number.
+func writePacket(w io.Writer, payload []byte, seq byte) error {
+	header := [4]byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ParseInitialHandshake extracts the auth plugin name and salt ("auth
+// plugin data") from a protocol-version-10 initial handshake packet, the
+// first packet a MySQL server sends on connect.
+func ParseInitialHandshake(pkt []byte) (authPluginName string, salt []byte, err error) {
+	// protocol version (1) + null-terminated server version + connection id (4)
+	pos := bytes.IndexByte(pkt[1:], 0)
+	if pos < 0 {
+		return "", nil, fmt.Errorf("mysql: malformed initial handshake packet")
+	}
+	pos = 1 + pos + 1 + 4
+
+	if pos+8 > len(pkt) {
+		return "", nil, fmt.Errorf("mysql: truncated initial handshake packet")
+	}
+	salt = append([]byte(nil), pkt[pos:pos+8]...)
+	pos += 8 + 1 // auth-plugin-data-part-1 + filler byte
+
+	if pos+2 > len(pkt) {
+		return "", nil, fmt.Errorf("mysql: truncated initial handshake packet")
+	}
+	pos += 2 // capability flags (lower 2 bytes)
+
+	if pos+1 > len(pkt) {
+		// No character set / status / upper capability bytes: pre-4.1
+		// server, which this client doesn't support.
+		return "", nil, fmt.Errorf("mysql: server handshake packet too old")
+	}
+	pos++ // character set
+	pos += 2 // status flags
+	pos += 2 // capability flags (upper 2 bytes)
+
+	if pos+1 > len(pkt) {
+		return "", nil, fmt.Errorf("mysql: truncated initial handshake packet")
+	}
+	authPluginDataLen := int(pkt[pos])
+	pos++
+	pos += 10 // reserved
+
+	if authPluginDataLen > 8 {
+		extra := authPluginDataLen - 8
+		if extra > 0 {
+			extra-- // the extra salt bytes are themselves NUL-terminated
+		}
+		if pos+extra > len(pkt) {
+			return "", nil, fmt.Errorf("mysql: truncated initial handshake packet")
+		}
+		salt = append(salt, pkt[pos:pos+extra]...)
+		pos += extra + 1
+	}
+
+	if pos >= len(pkt) {
+		// No auth-plugin-name: fall back to mysql_native_password.
+		return "mysql_native_password", salt, nil
+	}
+	name := pkt[pos:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name), salt, nil
+}
+
+// Negotiate drives the client side of MySQL auth-plugin negotiation after
+// the caller has already sent a HandshakeResponse41 packet whose auth
+// response was computed with GetAuthMethod(pluginName, tls).InitialResponse
+// (pluginName/salt as returned by ParseInitialHandshake). From there it
+// follows any AuthSwitchRequest or plugin-specific AuthMoreData packets the
+// server sends - dispatching each to the right AuthMethod via GetAuthMethod
+// - until it receives an OK or ERR packet.
+//
+// rw is the connection's packet stream; seq is the sequence number of the
+// HandshakeResponse41 packet the caller already sent.
+func Negotiate(rw io.ReadWriter, seq byte, pluginName string, salt []byte, password string, tls bool) error {
+	method, err := GetAuthMethod(pluginName, tls)
+	if err != nil {
+		return err
+	}
+
+	for {
+		pkt, pseq, err := readPacket(rw)
+		if err != nil {
+			return err
+		}
+		seq = pseq
+
+		var resp []byte
+		switch {
+		case len(pkt) == 0:
+			// A zero-length continuation packet is legitimate (e.g.
+			// caching_sha2_password's server sends one in place of the
+			// requested RSA public key to mean "ask again with 0x02");
+			// let the active plugin decide how to respond rather than
+			// rejecting it outright.
+			resp, err = method.Continue(pkt)
+			if err != nil {
+				return err
+			}
+		case pkt[0] == packetOK:
+			return nil
+		case pkt[0] == packetErr:
+			return fmt.Errorf("mysql: authentication failed: %s", pkt[1:])
+		case pkt[0] == packetAuthSwitch:
+			// AuthSwitchRequest: 0xfe, a NUL-terminated plugin name, then
+			// that plugin's initial auth data (its new salt) for the rest
+			// of the packet.
+			rest := pkt[1:]
+			nul := bytes.IndexByte(rest, 0)
+			if nul < 0 {
+				return fmt.Errorf("mysql: malformed AuthSwitchRequest packet")
+			}
+			newPluginName := string(rest[:nul])
+			newSalt := rest[nul+1:]
+
+			method, err = GetAuthMethod(newPluginName, tls)
+			if err != nil {
+				return err
+			}
+			resp, err = method.InitialResponse(newSalt, password)
+			if err != nil {
+				return err
+			}
+		default:
+			// AuthMoreData (0x01) or a plugin-specific continuation
+			// packet; strip the AuthMoreData marker, if present, and let
+			// the active plugin decide what to send back.
+			body := pkt
+			if pkt[0] == packetAuthMoreData {
+				body = pkt[1:]
+			}
+			resp, err = method.Continue(body)
+			if err != nil {
+				return err
+			}
+		}
+
+		if resp == nil {
+			continue
+		}
+		seq++
+		if err := writePacket(rw, resp, seq); err != nil {
+			return err
+		}
+	}
+}
@@ -204,3 +204,79 @@ func TypeToMySQL(typ querypb.Type) (mysqlType, flags int64) {
 	val := typeToMySQL[typ]
 	return val.typ, val.flags >> 16
 }
+
+// pgToType is derived from the postgres pg_type OIDs for the types we
+// support. Array OIDs are mapped to the scalar VarChar type since vitess
+// has no native array representation; the array literal is carried as text.
+//
+// If you add to this map, make sure you add a test case
+// in tabletserver/endtoend.
+var pgToType = map[int64]querypb.Type{
+	16:   Int8,      // bool
+	17:   VarBinary, // bytea
+	20:   Int64,     // int8
+	21:   Int16,     // int2
+	23:   Int32,     // int4
+	25:   Text,      // text
+	114:  Text,      // json
+	700:  Float32,   // float4
+	701:  Float64,   // float8
+	1042: Char,      // bpchar
+	1043: VarChar,   // varchar
+	1082: Date,      // date
+	1083: Time,      // time
+	1114: Datetime,  // timestamp
+	1184: Datetime,  // timestamptz
+	1700: Decimal,   // numeric
+	3802: Text,      // jsonb
+
+	// array variants
+	1000: VarChar, // _bool
+	1001: VarChar, // _bytea
+	1005: VarChar, // _int2
+	1007: VarChar, // _int4
+	1009: VarChar, // _text
+	1016: VarChar, // _int8
+	1021: VarChar, // _float4
+	1022: VarChar, // _float8
+	1231: VarChar, // _numeric
+}
+
+// typeToPg is the reverse of pgToType, picking the canonical postgres OID
+// for each vitess type.
+var typeToPg = map[querypb.Type]int64{
+	Int8:      16,   // bool
+	Int16:     21,   // int2
+	Int32:     23,   // int4
+	Int64:     20,   // int8
+	Float32:   700,  // float4
+	Float64:   701,  // float8
+	Decimal:   1700, // numeric
+	Text:      25,   // text
+	VarChar:   1043, // varchar
+	Char:      1042, // bpchar
+	VarBinary: 17,   // bytea
+	Binary:    17,   // bytea
+	Date:      1082, // date
+	Time:      1083, // time
+	Datetime:  1114, // timestamp
+	Timestamp: 1114, // timestamp
+}
+
+// PgToType computes the vitess type from a postgres pg_type OID.
+func PgToType(pgType int64) (typ querypb.Type, err error) {
+	result, ok := pgToType[pgType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported postgres type: %d", pgType)
+	}
+	return result, nil
+}
+
+// TypeToPg returns the equivalent postgres pg_type OID for a vitess type.
+func TypeToPg(typ querypb.Type) (pgType int64, err error) {
+	result, ok := typeToPg[typ]
+	if !ok {
+		return 0, fmt.Errorf("unsupported vitess type for postgres: %v", typ)
+	}
+	return result, nil
+}
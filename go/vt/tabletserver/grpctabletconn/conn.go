@@ -0,0 +1,464 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package grpctabletconn implements the gRPC version of the TabletDialer
+// interface.
+package grpctabletconn
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	querypb "github.com/youtube/vitess/go/vt/proto/query"
+	"github.com/youtube/vitess/go/vt/proto/queryservice"
+	topodatapb "github.com/youtube/vitess/go/vt/proto/topodata"
+	"github.com/youtube/vitess/go/vt/tabletserver/querytypes"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+)
+
+var (
+	// enableQueryCancellation, when set, makes this dialer open a sidecar
+	// connection to each backend so that a cancelled or timed-out
+	// context can actually interrupt the in-flight MySQL query on the
+	// server, instead of just dropping the RPC reply while the query
+	// keeps running.
+	enableQueryCancellation = flag.Bool("enable_query_cancellation", false, "issue KILL QUERY on the backend when a tablet RPC's context is cancelled or times out")
+)
+
+func init() {
+	tabletconn.RegisterDialer("grpc", DialTablet)
+}
+
+// gRPCQueryClient implements tabletconn.TabletConn by forwarding to a
+// queryservice.QueryClient gRPC stub.
+type gRPCQueryClient struct {
+	cc       *grpc.ClientConn
+	c        queryservice.QueryClient
+	endPoint *topodatapb.EndPoint
+
+	keyspace   string
+	shard      string
+	tabletType topodatapb.TabletType
+
+	canceller *queryCanceller
+}
+
+// DialTablet creates and initializes gRPCQueryClient, and, if
+// -enable_query_cancellation is set, its sidecar kill connection.
+func DialTablet(ctx context.Context, endPoint *topodatapb.EndPoint, keyspace, shard string, tabletType topodatapb.TabletType, timeout time.Duration) (tabletconn.TabletConn, error) {
+	addr := fmt.Sprintf("%v:%v", endPoint.Host, endPoint.PortMap["grpc"])
+	cc, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithTimeout(timeout), grpc.WithBlock())
+	if err != nil {
+		return nil, err
+	}
+	c := queryservice.NewQueryClient(cc)
+
+	conn := &gRPCQueryClient{
+		cc:         cc,
+		c:          c,
+		endPoint:   endPoint,
+		keyspace:   keyspace,
+		shard:      shard,
+		tabletType: tabletType,
+	}
+
+	if *enableQueryCancellation {
+		canceller, err := dialQueryCanceller(ctx, addr, conn.target())
+		if err != nil {
+			// Cancellation is a best-effort add-on: if we can't set up the
+			// sidecar, keep serving queries uncancellable rather than
+			// failing the dial outright.
+			log.Warningf("grpctabletconn: could not set up query cancellation sidecar for %v: %v", addr, err)
+		} else {
+			conn.canceller = canceller
+		}
+	}
+
+	return conn, nil
+}
+
+// Execute is part of the TabletConn interface.
+func (conn *gRPCQueryClient) Execute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*sqltypes.Result, error) {
+	var result *sqltypes.Result
+	err := conn.withCancellation(ctx, func(ctx context.Context, c queryservice.QueryClient) error {
+		req := &querypb.ExecuteRequest{
+			Target:        conn.target(),
+			Query:         &querypb.BoundQuery{Sql: query},
+			TransactionId: transactionID,
+		}
+		reply, err := c.Execute(ctx, req)
+		if err != nil {
+			return err
+		}
+		result = sqltypes.Proto3ToResult(reply.Result)
+		return nil
+	})
+	return result, err
+}
+
+// withCancellation runs fn against the QueryClient that should execute the
+// query, and, if query cancellation is enabled, races it against the
+// passed-in context: on cancellation it issues KILL QUERY against the
+// CONNECTION_ID() actually backing that call and translates the server
+// error into the appropriate context error. Execute and ExecuteBatch route
+// through this so the translation is applied consistently; StreamExecute
+// follows the same pattern but can't use this helper directly since it
+// hands back a stream instead of returning once fn completes.
+func (conn *gRPCQueryClient) withCancellation(ctx context.Context, fn func(context.Context, queryservice.QueryClient) error) error {
+	if conn.canceller == nil {
+		return fn(ctx, conn.c)
+	}
+
+	err := conn.canceller.withWorker(ctx, func(c queryservice.QueryClient) error {
+		return fn(ctx, c)
+	})
+	if err != nil && isKilledByCancellation(err) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+	return err
+}
+
+// ExecuteBatch is part of the TabletConn interface.
+func (conn *gRPCQueryClient) ExecuteBatch(ctx context.Context, queries []querytypes.BoundQuery, asTransaction bool, transactionID int64) ([]sqltypes.Result, error) {
+	var results []sqltypes.Result
+	err := conn.withCancellation(ctx, func(ctx context.Context, c queryservice.QueryClient) error {
+		boundQueries := make([]*querypb.BoundQuery, len(queries))
+		for i, q := range queries {
+			boundQueries[i] = &querypb.BoundQuery{Sql: q.Sql}
+		}
+		req := &querypb.ExecuteBatchRequest{
+			Target:        conn.target(),
+			Queries:       boundQueries,
+			AsTransaction: asTransaction,
+			TransactionId: transactionID,
+		}
+		reply, err := c.ExecuteBatch(ctx, req)
+		if err != nil {
+			return err
+		}
+		results = make([]sqltypes.Result, len(reply.Results))
+		for i, r := range reply.Results {
+			results[i] = *sqltypes.Proto3ToResult(r)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// StreamExecute is part of the TabletConn interface.
+func (conn *gRPCQueryClient) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}) (sqltypes.ResultStream, error) {
+	req := &querypb.StreamExecuteRequest{
+		Target: conn.target(),
+		Query:  &querypb.BoundQuery{Sql: query},
+	}
+
+	if conn.canceller == nil {
+		stream, err := conn.c.StreamExecute(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &grpcResultStream{stream: stream}, nil
+	}
+
+	worker := conn.canceller.checkout()
+	stream, err := worker.c.StreamExecute(ctx, req)
+	if err != nil {
+		conn.canceller.checkin(worker)
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go conn.canceller.watch(ctx, worker.connectionID, done)
+	return &cancellableStream{ctx: ctx, stream: stream, done: done, canceller: conn.canceller, worker: worker}, nil
+}
+
+// Begin is part of the TabletConn interface.
+func (conn *gRPCQueryClient) Begin(ctx context.Context) (int64, error) {
+	reply, err := conn.c.Begin(ctx, &querypb.BeginRequest{Target: conn.target()})
+	if err != nil {
+		return 0, err
+	}
+	return reply.TransactionId, nil
+}
+
+// Commit is part of the TabletConn interface.
+func (conn *gRPCQueryClient) Commit(ctx context.Context, transactionID int64) error {
+	_, err := conn.c.Commit(ctx, &querypb.CommitRequest{Target: conn.target(), TransactionId: transactionID})
+	return err
+}
+
+// Rollback is part of the TabletConn interface.
+func (conn *gRPCQueryClient) Rollback(ctx context.Context, transactionID int64) error {
+	_, err := conn.c.Rollback(ctx, &querypb.RollbackRequest{Target: conn.target(), TransactionId: transactionID})
+	return err
+}
+
+// BeginExecute is part of the TabletConn interface.
+func (conn *gRPCQueryClient) BeginExecute(ctx context.Context, query string, bindVars map[string]interface{}) (*sqltypes.Result, int64, error) {
+	transactionID, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := conn.Execute(ctx, query, bindVars, transactionID)
+	return result, transactionID, err
+}
+
+// BeginExecuteBatch is part of the TabletConn interface.
+func (conn *gRPCQueryClient) BeginExecuteBatch(ctx context.Context, queries []querytypes.BoundQuery, asTransaction bool) ([]sqltypes.Result, int64, error) {
+	transactionID, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	results, err := conn.ExecuteBatch(ctx, queries, asTransaction, transactionID)
+	return results, transactionID, err
+}
+
+// SplitQuery is part of the TabletConn interface.
+func (conn *gRPCQueryClient) SplitQuery(ctx context.Context, query querytypes.BoundQuery, splitColumn string, splitCount int64) ([]querytypes.QuerySplit, error) {
+	return nil, fmt.Errorf("grpctabletconn: SplitQuery is deprecated, use SplitQueryV2")
+}
+
+// SplitQueryV2 is part of the TabletConn interface.
+func (conn *gRPCQueryClient) SplitQueryV2(ctx context.Context, query querytypes.BoundQuery, splitColumns []string, splitCount int64, numRowsPerQueryPart int64, algorithm querypb.SplitQueryRequest_Algorithm) ([]querytypes.QuerySplit, error) {
+	return nil, fmt.Errorf("grpctabletconn: SplitQueryV2 not implemented in this build")
+}
+
+// StreamHealth is part of the TabletConn interface.
+func (conn *gRPCQueryClient) StreamHealth(ctx context.Context) (tabletconn.StreamHealthReader, error) {
+	return conn.c.StreamHealth(ctx, &querypb.StreamHealthRequest{})
+}
+
+func (conn *gRPCQueryClient) target() *querypb.Target {
+	return &querypb.Target{Keyspace: conn.keyspace, Shard: conn.shard, TabletType: conn.tabletType}
+}
+
+// Close is part of the TabletConn interface.
+func (conn *gRPCQueryClient) Close() {
+	if conn.canceller != nil {
+		conn.canceller.close()
+	}
+	conn.cc.Close()
+}
+
+// SetTarget is part of the TabletConn interface.
+func (conn *gRPCQueryClient) SetTarget(keyspace, shard string, tabletType topodatapb.TabletType) error {
+	conn.keyspace = keyspace
+	conn.shard = shard
+	conn.tabletType = tabletType
+	return nil
+}
+
+// EndPoint is part of the TabletConn interface.
+func (conn *gRPCQueryClient) EndPoint() *topodatapb.EndPoint {
+	return conn.endPoint
+}
+
+type grpcResultStream struct {
+	stream queryservice.Query_StreamExecuteClient
+}
+
+// Recv is part of the sqltypes.ResultStream interface.
+func (s *grpcResultStream) Recv() (*sqltypes.Result, error) {
+	r, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return sqltypes.Proto3ToResult(r.Result), nil
+}
+
+// cancellableStream wraps a grpc stream and stops the background canceller
+// watcher once the stream is drained or errors out, translating a
+// cancellation-induced server error into ctx.Err() the same way
+// withCancellation does for Execute and ExecuteBatch. It also checks its
+// pooled worker connection back in at that point, since it was checked out
+// for the lifetime of this stream.
+type cancellableStream struct {
+	ctx       context.Context
+	stream    queryservice.Query_StreamExecuteClient
+	done      chan struct{}
+	closed    bool
+	canceller *queryCanceller
+	worker    *pooledWorkerConn
+}
+
+// Recv is part of the sqltypes.ResultStream interface.
+func (s *cancellableStream) Recv() (*sqltypes.Result, error) {
+	r, err := s.stream.Recv()
+	if err != nil && !s.closed {
+		s.closed = true
+		close(s.done)
+		s.canceller.checkin(s.worker)
+	}
+	if err != nil {
+		if isKilledByCancellation(err) {
+			select {
+			case <-s.ctx.Done():
+				return nil, s.ctx.Err()
+			default:
+			}
+		}
+		return nil, err
+	}
+	return sqltypes.Proto3ToResult(r.Result), nil
+}
+
+// queryCancellationPoolSize is the number of worker connections
+// dialQueryCanceller opens to the backend, each with its own remembered
+// CONNECTION_ID(). Queries are dispatched on one of these, checked out for
+// the call's duration, rather than on a single shared connection, so that
+// cancelling one in-flight call's context can never end up issuing KILL
+// QUERY against the connection actually serving an unrelated call.
+const queryCancellationPoolSize = 4
+
+// queryCanceller holds a sidecar gRPC connection used purely to issue
+// "KILL QUERY <id>" against the backend, plus a pool of worker
+// connections that real queries are dispatched on. Each worker remembers
+// its own CONNECTION_ID(), so cancellation always targets the connection
+// that is actually running the query being cancelled.
+type queryCanceller struct {
+	killCC *grpc.ClientConn
+	killC  queryservice.QueryClient
+	target *querypb.Target
+	pool   chan *pooledWorkerConn
+}
+
+// pooledWorkerConn is one connection in a queryCanceller's pool: its own
+// gRPC connection to the backend, and the CONNECTION_ID() it was assigned
+// when dialed, which holds for as long as the connection stays open.
+type pooledWorkerConn struct {
+	cc           *grpc.ClientConn
+	c            queryservice.QueryClient
+	connectionID int64
+}
+
+// dialQueryCanceller opens the sidecar kill connection and a pool of
+// worker connections to addr, recording each worker's CONNECTION_ID() as
+// it's dialed. target is reused for every RPC so they're routed the same
+// way as the primary connection's queries.
+func dialQueryCanceller(ctx context.Context, addr string, target *querypb.Target) (*queryCanceller, error) {
+	killCC, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	killC := queryservice.NewQueryClient(killCC)
+
+	pool := make(chan *pooledWorkerConn, queryCancellationPoolSize)
+	for i := 0; i < queryCancellationPoolSize; i++ {
+		worker, err := dialPooledWorkerConn(ctx, addr, target)
+		if err != nil {
+			killCC.Close()
+			close(pool)
+			for w := range pool {
+				w.cc.Close()
+			}
+			return nil, err
+		}
+		pool <- worker
+	}
+
+	return &queryCanceller{killCC: killCC, killC: killC, target: target, pool: pool}, nil
+}
+
+// dialPooledWorkerConn dials one more backend connection and records the
+// CONNECTION_ID() MySQL assigned it.
+func dialPooledWorkerConn(ctx context.Context, addr string, target *querypb.Target) (*pooledWorkerConn, error) {
+	cc, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	c := queryservice.NewQueryClient(cc)
+
+	reply, err := c.Execute(ctx, &querypb.ExecuteRequest{
+		Target: target,
+		Query:  &querypb.BoundQuery{Sql: "SELECT CONNECTION_ID()"},
+	})
+	if err != nil {
+		cc.Close()
+		return nil, fmt.Errorf("could not fetch CONNECTION_ID(): %v", err)
+	}
+	result := sqltypes.Proto3ToResult(reply.Result)
+	if len(result.Rows) != 1 || len(result.Rows[0]) != 1 {
+		cc.Close()
+		return nil, fmt.Errorf("unexpected CONNECTION_ID() result: %v", result)
+	}
+	connectionID, err := strconv.ParseInt(result.Rows[0][0].String(), 10, 64)
+	if err != nil {
+		cc.Close()
+		return nil, fmt.Errorf("could not parse CONNECTION_ID(): %v", err)
+	}
+
+	return &pooledWorkerConn{cc: cc, c: c, connectionID: connectionID}, nil
+}
+
+// checkout blocks until a pooled worker connection is available.
+func (k *queryCanceller) checkout() *pooledWorkerConn {
+	return <-k.pool
+}
+
+// checkin returns a worker connection checked out via checkout.
+func (k *queryCanceller) checkin(worker *pooledWorkerConn) {
+	k.pool <- worker
+}
+
+// withWorker checks out a pooled worker connection, runs fn against its
+// QueryClient, and checks it back in once fn returns.
+func (k *queryCanceller) withWorker(ctx context.Context, fn func(queryservice.QueryClient) error) error {
+	worker := k.checkout()
+	defer k.checkin(worker)
+
+	done := make(chan struct{})
+	defer close(done)
+	go k.watch(ctx, worker.connectionID, done)
+
+	return fn(worker.c)
+}
+
+// watch blocks until either ctx is done or done is closed (the call it
+// guards finished on its own). On context cancellation it issues KILL
+// QUERY against the worker connection identified by connectionID, using
+// the sidecar kill connection so the KILL itself isn't blocked behind the
+// query it's trying to interrupt.
+func (k *queryCanceller) watch(ctx context.Context, connectionID int64, done chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	killCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := k.killC.Execute(killCtx, &querypb.ExecuteRequest{
+		Target: k.target,
+		Query:  &querypb.BoundQuery{Sql: fmt.Sprintf("KILL QUERY %d", connectionID)},
+	})
+	if err != nil {
+		log.Warningf("grpctabletconn: KILL QUERY %d failed: %v", connectionID, err)
+	}
+}
+
+func (k *queryCanceller) close() {
+	k.killCC.Close()
+	close(k.pool)
+	for worker := range k.pool {
+		worker.cc.Close()
+	}
+}
+
+// isKilledByCancellation returns true if err looks like the MySQL error
+// (1317, ER_QUERY_INTERRUPTED) raised on the connection that was the
+// target of a KILL QUERY.
+func isKilledByCancellation(err error) bool {
+	return strings.Contains(err.Error(), "1317") || strings.Contains(err.Error(), "ER_QUERY_INTERRUPTED")
+}
@@ -0,0 +1,87 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpctabletconn
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	querypb "github.com/youtube/vitess/go/vt/proto/query"
+	"github.com/youtube/vitess/go/vt/proto/queryservice"
+)
+
+// fakeSleepyBackend simulates a backend running a long query (e.g.
+// SELECT SLEEP(30)): it blocks until killed is closed, then returns the
+// error a real vttablet/MySQL would after a KILL QUERY.
+type fakeSleepyBackend struct {
+	queryservice.QueryClient
+	killed chan struct{}
+}
+
+func (f *fakeSleepyBackend) Execute(ctx context.Context, req *querypb.ExecuteRequest, opts ...grpc.CallOption) (*querypb.ExecuteResponse, error) {
+	select {
+	case <-f.killed:
+		return nil, fmt.Errorf("vttablet: error 1317 (70100): Query execution was interrupted")
+	case <-time.After(30 * time.Second):
+		return &querypb.ExecuteResponse{}, nil
+	}
+}
+
+// fakeKiller stands in for the sidecar connection's backend: its Execute
+// is what watch() calls to issue KILL QUERY, and closing killed is what
+// unblocks fakeSleepyBackend.
+type fakeKiller struct {
+	queryservice.QueryClient
+	killed chan struct{}
+}
+
+func (f *fakeKiller) Execute(ctx context.Context, req *querypb.ExecuteRequest, opts ...grpc.CallOption) (*querypb.ExecuteResponse, error) {
+	close(f.killed)
+	return &querypb.ExecuteResponse{}, nil
+}
+
+// TestQueryCancellationKillsLongRunningQuery verifies that cancelling the
+// context passed to Execute causes the sidecar canceller to issue KILL
+// QUERY, and that Execute returns ctx.Err() in a bounded time instead of
+// waiting out the full query.
+func TestQueryCancellationKillsLongRunningQuery(t *testing.T) {
+	killed := make(chan struct{})
+	pool := make(chan *pooledWorkerConn, 1)
+	pool <- &pooledWorkerConn{c: &fakeSleepyBackend{killed: killed}, connectionID: 42}
+	conn := &gRPCQueryClient{
+		canceller: &queryCanceller{
+			killC:  &fakeKiller{killed: killed},
+			target: &querypb.Target{Keyspace: "ks", Shard: "0"},
+			pool:   pool,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := conn.Execute(ctx, "SELECT SLEEP(30)", nil, 0)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("Execute took %v to return after cancellation, want well under 30s", elapsed)
+		}
+		if err != context.Canceled {
+			t.Fatalf("Execute returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Execute did not return within 5s of ctx.Cancel()")
+	}
+}
@@ -0,0 +1,440 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pgtabletconn implements the TabletDialer interface for a vttablet
+// that fronts a PostgreSQL server instead of MySQL. It lets vtgate shard on
+// top of Postgres without changing the query serving surface: callers still
+// go through the regular TabletConn interface, and type translation between
+// postgres and vitess happens in sqltypes.PgToType/TypeToPg.
+package pgtabletconn
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	"golang.org/x/net/context"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	querypb "github.com/youtube/vitess/go/vt/proto/query"
+	topodatapb "github.com/youtube/vitess/go/vt/proto/topodata"
+	"github.com/youtube/vitess/go/vt/tabletserver/querytypes"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+)
+
+// streamBatchRows caps how many rows pgResultStream buffers per Recv call,
+// so a StreamExecute consumer gets bounded-memory batches instead of the
+// whole result set in one shot.
+const streamBatchRows = 256
+
+func init() {
+	tabletconn.RegisterDialer("postgres", DialTablet)
+}
+
+// pgTabletConn implements TabletConn over a database/sql connection to a
+// PostgreSQL backend, using the postgres wire protocol driver (lib/pq).
+type pgTabletConn struct {
+	db       *sql.DB
+	endPoint *topodatapb.EndPoint
+
+	keyspace   string
+	shard      string
+	tabletType topodatapb.TabletType
+
+	mu       sync.Mutex
+	nextTxID int64
+	txs      map[int64]*sql.Tx
+}
+
+// DialTablet creates a new pgTabletConn and opens the underlying postgres
+// connection pool. It is registered under the "postgres" tablet protocol.
+func DialTablet(ctx context.Context, endPoint *topodatapb.EndPoint, keyspace, shard string, tabletType topodatapb.TabletType, timeout time.Duration) (tabletconn.TabletConn, error) {
+	dsn := fmt.Sprintf("host=%s port=%d sslmode=disable", endPoint.Host, portForTablet(endPoint))
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(timeout)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &pgTabletConn{
+		db:         db,
+		endPoint:   endPoint,
+		keyspace:   keyspace,
+		shard:      shard,
+		tabletType: tabletType,
+		txs:        make(map[int64]*sql.Tx),
+	}, nil
+}
+
+func portForTablet(endPoint *topodatapb.EndPoint) int32 {
+	for _, pm := range endPoint.PortMap {
+		return pm
+	}
+	return 5432
+}
+
+// Execute is part of the TabletConn interface.
+func (conn *pgTabletConn) Execute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*sqltypes.Result, error) {
+	pgQuery, args := rewriteQuery(query, bindVars)
+	rows, err := conn.queryContext(ctx, transactionID, pgQuery, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return toResult(rows)
+}
+
+// queryContext runs a query either against a pooled connection (when
+// transactionID is 0) or against the *sql.Tx previously opened by Begin.
+func (conn *pgTabletConn) queryContext(ctx context.Context, transactionID int64, pgQuery string, args []interface{}) (*sql.Rows, error) {
+	if transactionID == 0 {
+		return conn.db.QueryContext(ctx, pgQuery, args...)
+	}
+	tx, err := conn.getTx(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return tx.QueryContext(ctx, pgQuery, args...)
+}
+
+func (conn *pgTabletConn) getTx(transactionID int64) (*sql.Tx, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	tx, ok := conn.txs[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("pgtabletconn: no such transaction: %d", transactionID)
+	}
+	return tx, nil
+}
+
+// ExecuteBatch is part of the TabletConn interface. When asTransaction is
+// set and the caller didn't already supply a transactionID, the batch runs
+// inside a transaction opened and closed just for it, so a failure partway
+// through rolls back the queries that already ran instead of leaving them
+// committed.
+func (conn *pgTabletConn) ExecuteBatch(ctx context.Context, queries []querytypes.BoundQuery, asTransaction bool, transactionID int64) ([]sqltypes.Result, error) {
+	ownTransaction := asTransaction && transactionID == 0
+	if ownTransaction {
+		ownTxID, err := conn.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		transactionID = ownTxID
+	}
+
+	results := make([]sqltypes.Result, 0, len(queries))
+	for _, q := range queries {
+		result, err := conn.Execute(ctx, q.Sql, q.BindVariables, transactionID)
+		if err != nil {
+			if ownTransaction {
+				conn.Rollback(ctx, transactionID)
+			}
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+
+	if ownTransaction {
+		if err := conn.Commit(ctx, transactionID); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// StreamExecute is part of the TabletConn interface.
+func (conn *pgTabletConn) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}) (sqltypes.ResultStream, error) {
+	pgQuery, args := rewriteQuery(query, bindVars)
+	rows, err := conn.db.QueryContext(ctx, pgQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &pgResultStream{rows: rows}, nil
+}
+
+// Begin is part of the TabletConn interface. It opens a real postgres
+// transaction via database/sql and hands back an id that Execute/Commit/
+// Rollback use to find it again.
+func (conn *pgTabletConn) Begin(ctx context.Context) (int64, error) {
+	tx, err := conn.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	conn.mu.Lock()
+	conn.nextTxID++
+	transactionID := conn.nextTxID
+	conn.txs[transactionID] = tx
+	conn.mu.Unlock()
+	return transactionID, nil
+}
+
+// Commit is part of the TabletConn interface.
+func (conn *pgTabletConn) Commit(ctx context.Context, transactionID int64) error {
+	tx, err := conn.popTx(transactionID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Rollback is part of the TabletConn interface.
+func (conn *pgTabletConn) Rollback(ctx context.Context, transactionID int64) error {
+	tx, err := conn.popTx(transactionID)
+	if err != nil {
+		return err
+	}
+	return tx.Rollback()
+}
+
+// popTx removes and returns the *sql.Tx for transactionID; it is used by
+// Commit/Rollback, which both end the transaction's lifetime.
+func (conn *pgTabletConn) popTx(transactionID int64) (*sql.Tx, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	tx, ok := conn.txs[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("pgtabletconn: no such transaction: %d", transactionID)
+	}
+	delete(conn.txs, transactionID)
+	return tx, nil
+}
+
+// BeginExecute is part of the TabletConn interface.
+func (conn *pgTabletConn) BeginExecute(ctx context.Context, query string, bindVars map[string]interface{}) (*sqltypes.Result, int64, error) {
+	transactionID, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := conn.Execute(ctx, query, bindVars, transactionID)
+	return result, transactionID, err
+}
+
+// BeginExecuteBatch is part of the TabletConn interface.
+func (conn *pgTabletConn) BeginExecuteBatch(ctx context.Context, queries []querytypes.BoundQuery, asTransaction bool) ([]sqltypes.Result, int64, error) {
+	transactionID, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	results, err := conn.ExecuteBatch(ctx, queries, asTransaction, transactionID)
+	return results, transactionID, err
+}
+
+// Close is part of the TabletConn interface.
+func (conn *pgTabletConn) Close() {
+	conn.db.Close()
+}
+
+// SetTarget is part of the TabletConn interface.
+func (conn *pgTabletConn) SetTarget(keyspace, shard string, tabletType topodatapb.TabletType) error {
+	conn.keyspace = keyspace
+	conn.shard = shard
+	conn.tabletType = tabletType
+	return nil
+}
+
+// EndPoint is part of the TabletConn interface.
+func (conn *pgTabletConn) EndPoint() *topodatapb.EndPoint {
+	return conn.endPoint
+}
+
+// SplitQuery is part of the TabletConn interface.
+func (conn *pgTabletConn) SplitQuery(ctx context.Context, query querytypes.BoundQuery, splitColumn string, splitCount int64) ([]querytypes.QuerySplit, error) {
+	return nil, fmt.Errorf("pgtabletconn: SplitQuery is not supported")
+}
+
+// SplitQueryV2 is part of the TabletConn interface.
+func (conn *pgTabletConn) SplitQueryV2(ctx context.Context, query querytypes.BoundQuery, splitColumns []string, splitCount int64, numRowsPerQueryPart int64, algorithm querypb.SplitQueryRequest_Algorithm) ([]querytypes.QuerySplit, error) {
+	return nil, fmt.Errorf("pgtabletconn: SplitQueryV2 is not supported")
+}
+
+// StreamHealth is part of the TabletConn interface.
+func (conn *pgTabletConn) StreamHealth(ctx context.Context) (tabletconn.StreamHealthReader, error) {
+	return nil, fmt.Errorf("pgtabletconn: StreamHealth is not supported")
+}
+
+// rewriteQuery turns a vitess bound query, which references bind variables
+// as ":name", into a postgres query using "$1", "$2", ... placeholders, and
+// returns the corresponding argument list in positional order.
+func rewriteQuery(query string, bindVars map[string]interface{}) (string, []interface{}) {
+	var out strings.Builder
+	var args []interface{}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c != ':' {
+			out.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(query) && isIdentByte(query[j]) {
+			j++
+		}
+		name := query[i+1 : j]
+		if name == "" {
+			out.WriteByte(c)
+			continue
+		}
+		args = append(args, bindVars[name])
+		out.WriteByte('$')
+		out.WriteString(strconv.Itoa(len(args)))
+		i = j - 1
+	}
+	return out.String(), args
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// fieldsOf translates the columns reported by rows into vitess Fields via
+// sqltypes.PgToType.
+func fieldsOf(rows *sql.Rows) ([]*querypb.Field, error) {
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]*querypb.Field, len(cols))
+	for i, col := range cols {
+		typ, err := sqltypes.PgToType(pgOID(col))
+		if err != nil {
+			typ = sqltypes.VarChar
+		}
+		fields[i] = &querypb.Field{Name: col.Name(), Type: typ}
+	}
+	return fields, nil
+}
+
+// scanRows reads up to maxRows rows from rows into sqltypes.Values, typed
+// according to fields so callers see the same int/float/string typing a
+// MySQL-backed TabletConn would report rather than generic text. It
+// returns done=true once rows.Next() reports no more rows are available.
+func scanRows(rows *sql.Rows, fields []*querypb.Field, maxRows int) (scanned [][]sqltypes.Value, done bool, err error) {
+	numCols := len(fields)
+	dest := make([]interface{}, numCols)
+	raw := make([]sql.RawBytes, numCols)
+	for i := range dest {
+		dest[i] = &raw[i]
+	}
+	for len(scanned) < maxRows {
+		if !rows.Next() {
+			return scanned, true, rows.Err()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, false, err
+		}
+		row := make([]sqltypes.Value, numCols)
+		for i, b := range raw {
+			row[i] = sqltypes.MakeTrusted(fields[i].Type, append([]byte(nil), b...))
+		}
+		scanned = append(scanned, row)
+	}
+	return scanned, false, nil
+}
+
+// toResult converts a *sql.Rows into a single *sqltypes.Result, for the
+// non-streaming Execute/ExecuteBatch calls which want the whole result.
+func toResult(rows *sql.Rows) (*sqltypes.Result, error) {
+	fields, err := fieldsOf(rows)
+	if err != nil {
+		return nil, err
+	}
+	rowValues, _, err := scanRows(rows, fields, 1<<31-1)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{Fields: fields, Rows: rowValues, RowsAffected: uint64(len(rowValues))}, nil
+}
+
+// pgOID returns the postgres type OID reported by the driver for a column,
+// if the driver exposes one via DatabaseTypeName lookups. lib/pq does not
+// expose raw OIDs through database/sql, so this is approximate and falls
+// back to text for anything it doesn't recognize.
+func pgOID(col *sql.ColumnType) int64 {
+	switch col.DatabaseTypeName() {
+	case "BOOL":
+		return 16
+	case "BYTEA":
+		return 17
+	case "INT8":
+		return 20
+	case "INT2":
+		return 21
+	case "INT4":
+		return 23
+	case "TEXT":
+		return 25
+	case "JSON":
+		return 114
+	case "FLOAT4":
+		return 700
+	case "FLOAT8":
+		return 701
+	case "BPCHAR":
+		return 1042
+	case "VARCHAR":
+		return 1043
+	case "DATE":
+		return 1082
+	case "TIME":
+		return 1083
+	case "TIMESTAMP":
+		return 1114
+	case "TIMESTAMPTZ":
+		return 1184
+	case "NUMERIC":
+		return 1700
+	case "JSONB":
+		return 3802
+	}
+	return 25
+}
+
+// pgResultStream adapts *sql.Rows to the sqltypes.ResultStream interface
+// expected by StreamExecute callers. It hands back at most streamBatchRows
+// rows per Recv call instead of buffering the whole result, and returns
+// io.EOF once the underlying rows have been fully drained and closed.
+type pgResultStream struct {
+	rows   *sql.Rows
+	fields []*querypb.Field
+	sent   bool
+}
+
+// Recv is part of the sqltypes.ResultStream interface.
+func (s *pgResultStream) Recv() (*sqltypes.Result, error) {
+	if s.sent {
+		return nil, io.EOF
+	}
+
+	if s.fields == nil {
+		fields, err := fieldsOf(s.rows)
+		if err != nil {
+			s.rows.Close()
+			s.sent = true
+			return nil, err
+		}
+		s.fields = fields
+	}
+
+	rowValues, done, err := scanRows(s.rows, s.fields, streamBatchRows)
+	if err != nil {
+		s.rows.Close()
+		s.sent = true
+		return nil, err
+	}
+	if done {
+		s.rows.Close()
+		s.sent = true
+		if len(rowValues) == 0 {
+			return nil, io.EOF
+		}
+	}
+	return &sqltypes.Result{Fields: s.fields, Rows: rowValues, RowsAffected: uint64(len(rowValues))}, nil
+}
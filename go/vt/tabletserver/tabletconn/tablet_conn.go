@@ -31,6 +31,12 @@ const (
 var (
 	// TabletProtocol is exported for unit tests
 	TabletProtocol = flag.String("tablet_protocol", "grpc", "how to talk to the vttablets")
+
+	// TabletAuthMethod selects the default MySQL authentication plugin
+	// (see go/mysql.AuthMethod) that dialers which speak the MySQL wire
+	// protocol should use when the server doesn't otherwise pin one via
+	// an AuthSwitchRequest.
+	TabletAuthMethod = flag.String("tablet_auth_method", "mysql_native_password", "the default MySQL authentication plugin to use when connecting to a vttablet's backend (mysql_native_password, caching_sha2_password, sha256_password)")
 )
 
 // ServerError represents an error that was returned from
@@ -0,0 +1,262 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/net/context"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	querypb "github.com/youtube/vitess/go/vt/proto/query"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// ShardStreamer opens the StreamExecute for one shard of a
+// KeyspaceIdBatchQuery. It's implemented by whatever dispatches the
+// per-shard queries (a Resolver, in the full executor); kept as a function
+// type here so this file doesn't need to depend on that package.
+type ShardStreamer func(ctx context.Context, shardIdx int) (sqltypes.ResultStream, error)
+
+// ExecuteOrderedKeyspaceIdBatchQuery is the entry point the executor calls
+// for a KeyspaceIdBatchQuery that carries an OrderBy/Limit: it opens each
+// shard's stream via open, then merges them with MergeOrderedStreams
+// instead of gathering every shard's full result before sorting.
+func ExecuteOrderedKeyspaceIdBatchQuery(ctx context.Context, numShards int, fields []*querypb.Field, orderBy []proto.OrderByColumn, limit *proto.QueryLimit, open ShardStreamer, sendReply func(*sqltypes.Result) error) error {
+	streams := make([]sqltypes.ResultStream, numShards)
+	// Each shard gets its own cancellable child context so that, once the
+	// merge below is done (whether it stopped early because limit was
+	// reached, or because of an error), any shard streams it didn't drain
+	// to io.EOF are torn down: cancelling ctx aborts the underlying gRPC
+	// stream, and for pgtabletconn (whose rows come from QueryContext)
+	// closes the backing *sql.Rows, instead of leaking either one.
+	cancels := make([]context.CancelFunc, 0, numShards)
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	for i := 0; i < numShards; i++ {
+		shardCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		stream, err := open(shardCtx, i)
+		if err != nil {
+			return err
+		}
+		streams[i] = stream
+	}
+	return MergeOrderedStreams(streams, fields, orderBy, limit, sendReply)
+}
+
+// MergeOrderedStreams performs a bounded-memory k-way merge across the
+// per-shard result streams of a KeyspaceIdBatchQuery that carries an
+// OrderBy/Limit, instead of the old behavior of buffering every shard's
+// full result before sorting. It maintains a min-heap holding at most one
+// buffered row per shard: each iteration pops the overall next row in
+// OrderBy order, hands it to sendReply, and refills the heap with the next
+// row pulled from that same shard's stream.
+//
+// fields describes the columns of the (identically shaped) per-shard
+// results, and is used to resolve OrderBy column names to positions and to
+// pick a comparison appropriate to the column's type.
+func MergeOrderedStreams(streams []sqltypes.ResultStream, fields []*querypb.Field, orderBy []proto.OrderByColumn, limit *proto.QueryLimit, sendReply func(*sqltypes.Result) error) error {
+	cols, err := resolveOrderByColumns(fields, orderBy)
+	if err != nil {
+		return err
+	}
+
+	h := &mergeHeap{cols: cols}
+	for _, stream := range streams {
+		s := &shardStream{stream: stream}
+		s.advance()
+		if s.err != nil && s.err != io.EOF {
+			return s.err
+		}
+		if s.row != nil {
+			h.streams = append(h.streams, s)
+		}
+	}
+	heap.Init(h)
+
+	var offset, count int64
+	if limit != nil {
+		offset, count = limit.Offset, limit.Count
+	}
+
+	var sent int64
+	for h.Len() > 0 {
+		if count > 0 && sent >= count {
+			break
+		}
+		s := h.streams[0]
+		row := s.row
+
+		s.advance()
+		if s.err != nil && s.err != io.EOF {
+			return s.err
+		}
+		if s.row == nil {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+		sent++
+		if err := sendReply(&sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{row}, RowsAffected: 1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderByCol is a resolved OrderBy column: its position in the shared
+// field list, the sort direction, and the field type used to pick a
+// comparison function.
+type orderByCol struct {
+	index int
+	desc  bool
+	typ   querypb.Type
+}
+
+func resolveOrderByColumns(fields []*querypb.Field, orderBy []proto.OrderByColumn) ([]orderByCol, error) {
+	cols := make([]orderByCol, len(orderBy))
+	for i, ob := range orderBy {
+		index := -1
+		for j, f := range fields {
+			if f.Name == ob.Col {
+				index = j
+				break
+			}
+		}
+		if index == -1 {
+			return nil, fmt.Errorf("vtgate: OrderBy column %q not found in result", ob.Col)
+		}
+		cols[i] = orderByCol{index: index, desc: ob.Desc, typ: fields[index].Type}
+	}
+	return cols, nil
+}
+
+// shardStream wraps one shard's sqltypes.ResultStream and keeps exactly one
+// unconsumed row buffered in row, so the merge heap always has a row to
+// compare for every shard that isn't drained yet.
+type shardStream struct {
+	stream  sqltypes.ResultStream
+	pending []sqltypes.Value // rows queued from the last Result received but not yet surfaced
+	row     []sqltypes.Value
+	err     error
+}
+
+// advance pulls the next row into s.row, fetching another Result from the
+// underlying stream if the buffered one is exhausted. s.row is nil and
+// s.err is io.EOF once the shard is drained.
+func (s *shardStream) advance() {
+	for len(s.pending) == 0 {
+		result, err := s.stream.Recv()
+		if err != nil {
+			s.row, s.err = nil, err
+			return
+		}
+		s.pending = result.Rows
+	}
+	s.row, s.pending = s.pending[0], s.pending[1:]
+}
+
+// mergeHeap implements container/heap.Interface over the current frontier
+// row of each still-active shard, ordered by cols.
+type mergeHeap struct {
+	streams []*shardStream
+	cols    []orderByCol
+}
+
+func (h *mergeHeap) Len() int { return len(h.streams) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	return compareRows(h.streams[i].row, h.streams[j].row, h.cols) < 0
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.streams[i], h.streams[j] = h.streams[j], h.streams[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.streams = append(h.streams, x.(*shardStream)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := h.streams
+	n := len(old)
+	last := old[n-1]
+	h.streams = old[:n-1]
+	return last
+}
+
+// compareRows orders two rows according to cols, in the same ASC/DESC,
+// per-column precedence as a SQL ORDER BY clause.
+func compareRows(a, b []sqltypes.Value, cols []orderByCol) int {
+	for _, col := range cols {
+		cmp := compareValues(a[col.index], b[col.index], col.typ)
+		if col.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareValues compares two column values the way MySQL would for their
+// declared type: numerically for integral/float columns (respecting
+// unsigned types, since e.g. a UINT64 near/above MaxInt64 would otherwise
+// be misparsed as negative), case-insensitively for text columns to match
+// the case-insensitive collations (*_general_ci, *_unicode_ci, ...) MySQL
+// defaults varchar/text columns to, and byte-wise for anything binary.
+func compareValues(a, b sqltypes.Value, typ querypb.Type) int {
+	switch {
+	case sqltypes.IsUnsigned(typ):
+		au, _ := strconv.ParseUint(string(a.Raw()), 10, 64)
+		bu, _ := strconv.ParseUint(string(b.Raw()), 10, 64)
+		switch {
+		case au < bu:
+			return -1
+		case au > bu:
+			return 1
+		default:
+			return 0
+		}
+	case sqltypes.IsIntegral(typ):
+		ai, _ := strconv.ParseInt(string(a.Raw()), 10, 64)
+		bi, _ := strconv.ParseInt(string(b.Raw()), 10, 64)
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		default:
+			return 0
+		}
+	case sqltypes.IsFloat(typ):
+		af, _ := strconv.ParseFloat(string(a.Raw()), 64)
+		bf, _ := strconv.ParseFloat(string(b.Raw()), 64)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	case sqltypes.IsText(typ):
+		return bytes.Compare(bytes.ToLower(a.Raw()), bytes.ToLower(b.Raw()))
+	default:
+		// IsBinary and anything else falls back to a raw byte comparison,
+		// which matches MySQL's binary collations exactly.
+		return bytes.Compare(a.Raw(), b.Raw())
+	}
+}
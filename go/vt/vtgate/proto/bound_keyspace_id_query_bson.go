@@ -0,0 +1,74 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes BoundKeyspaceIdQuery.
+func (boundKeyspaceIdQuery *BoundKeyspaceIdQuery) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Sql", boundKeyspaceIdQuery.Sql)
+	bson.EncodeMap(buf, "BindVariables", boundKeyspaceIdQuery.BindVariables)
+	bson.EncodeString(buf, "Keyspace", boundKeyspaceIdQuery.Keyspace)
+	// [][]byte
+	{
+		bson.EncodePrefix(buf, bson.Array, "KeyspaceIds")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v1 := range boundKeyspaceIdQuery.KeyspaceIds {
+			bson.EncodeBinary(buf, bson.Itoa(_i), _v1)
+		}
+		lenWriter.Close()
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into BoundKeyspaceIdQuery.
+func (boundKeyspaceIdQuery *BoundKeyspaceIdQuery) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for BoundKeyspaceIdQuery", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Sql":
+			boundKeyspaceIdQuery.Sql = bson.DecodeString(buf, kind)
+		case "BindVariables":
+			boundKeyspaceIdQuery.BindVariables = bson.DecodeMap(buf, kind)
+		case "Keyspace":
+			boundKeyspaceIdQuery.Keyspace = bson.DecodeString(buf, kind)
+		case "KeyspaceIds":
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for boundKeyspaceIdQuery.KeyspaceIds", kind))
+				}
+				bson.Next(buf, 4)
+				boundKeyspaceIdQuery.KeyspaceIds = make([][]byte, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					boundKeyspaceIdQuery.KeyspaceIds = append(boundKeyspaceIdQuery.KeyspaceIds, bson.DecodeBinary(buf, kind))
+				}
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	topodatapb "github.com/youtube/vitess/go/vt/proto/topodata"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// KeyspaceIdBatchQuery is a batch of BoundKeyspaceIdQuery to route to
+// their respective shards and execute, optionally as a single cross-shard
+// transaction. OrderBy and Limit, when set, ask vtgate to merge the
+// per-shard results in OrderBy order (see MergeOrderedStreams) rather than
+// return them shard-by-shard.
+type KeyspaceIdBatchQuery struct {
+	CallerID      *tproto.CallerID
+	Queries       []BoundKeyspaceIdQuery
+	TabletType    topodatapb.TabletType
+	AsTransaction bool
+	Session       *Session
+	OrderBy       []OrderByColumn
+	Limit         *QueryLimit
+}
+
+// BoundKeyspaceIdQuery is a query bound to the keyspace ids it should be
+// routed to.
+type BoundKeyspaceIdQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Keyspace      string
+	KeyspaceIds   [][]byte
+}
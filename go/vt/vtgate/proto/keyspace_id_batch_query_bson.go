@@ -43,6 +43,21 @@ func (keyspaceIdBatchQuery *KeyspaceIdBatchQuery) MarshalBson(buf *bytes2.Chunke
 	} else {
 		(*keyspaceIdBatchQuery.Session).MarshalBson(buf, "Session")
 	}
+	// []OrderByColumn
+	{
+		bson.EncodePrefix(buf, bson.Array, "OrderBy")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v2 := range keyspaceIdBatchQuery.OrderBy {
+			_v2.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
+	// *QueryLimit
+	if keyspaceIdBatchQuery.Limit == nil {
+		bson.EncodePrefix(buf, bson.Null, "Limit")
+	} else {
+		(*keyspaceIdBatchQuery.Limit).MarshalBson(buf, "Limit")
+	}
 
 	lenWriter.Close()
 }
@@ -92,6 +107,27 @@ func (keyspaceIdBatchQuery *KeyspaceIdBatchQuery) UnmarshalBson(buf *bytes.Buffe
 				keyspaceIdBatchQuery.Session = new(Session)
 				(*keyspaceIdBatchQuery.Session).UnmarshalBson(buf, kind)
 			}
+		case "OrderBy":
+			// []OrderByColumn
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for keyspaceIdBatchQuery.OrderBy", kind))
+				}
+				bson.Next(buf, 4)
+				keyspaceIdBatchQuery.OrderBy = make([]OrderByColumn, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v2 OrderByColumn
+					_v2.UnmarshalBson(buf, kind)
+					keyspaceIdBatchQuery.OrderBy = append(keyspaceIdBatchQuery.OrderBy, _v2)
+				}
+			}
+		case "Limit":
+			// *QueryLimit
+			if kind != bson.Null {
+				keyspaceIdBatchQuery.Limit = new(QueryLimit)
+				(*keyspaceIdBatchQuery.Limit).UnmarshalBson(buf, kind)
+			}
 		default:
 			bson.Skip(buf, kind)
 		}
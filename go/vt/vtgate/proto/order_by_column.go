@@ -0,0 +1,14 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// OrderByColumn describes one column of a cross-shard ORDER BY clause
+// attached to a KeyspaceIdBatchQuery. Col is matched against the result
+// field names returned by each shard's StreamExecute, and Desc selects
+// ascending (the default) or descending order.
+type OrderByColumn struct {
+	Col  string
+	Desc bool
+}
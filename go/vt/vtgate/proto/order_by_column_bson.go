@@ -0,0 +1,50 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes OrderByColumn.
+func (orderByColumn *OrderByColumn) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Col", orderByColumn.Col)
+	bson.EncodeBool(buf, "Desc", orderByColumn.Desc)
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into OrderByColumn.
+func (orderByColumn *OrderByColumn) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for OrderByColumn", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Col":
+			orderByColumn.Col = bson.DecodeString(buf, kind)
+		case "Desc":
+			orderByColumn.Desc = bson.DecodeBool(buf, kind)
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
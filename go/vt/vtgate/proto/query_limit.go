@@ -0,0 +1,14 @@
+// Copyright 2016, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// QueryLimit bounds the number of rows a KeyspaceIdBatchQuery returns once
+// its per-shard results have been merged in OrderBy order. Offset rows are
+// dropped from the head of the merged stream before Count rows are
+// returned; a Count of 0 means unlimited.
+type QueryLimit struct {
+	Offset int64
+	Count  int64
+}
@@ -0,0 +1,25 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	topodatapb "github.com/youtube/vitess/go/vt/proto/topodata"
+)
+
+// Session carries the per-shard transactions a client has open, so a
+// later call in the same vtgate session can be routed to the same
+// transaction instead of starting a new one.
+type Session struct {
+	InTransaction bool
+	ShardSessions []*ShardSession
+}
+
+// ShardSession is one shard's open transaction within a Session.
+type ShardSession struct {
+	Keyspace      string
+	Shard         string
+	TabletType    topodatapb.TabletType
+	TransactionId int64
+}
@@ -0,0 +1,22 @@
+package vindexes
+
+import (
+	"encoding/binary"
+
+	"github.com/tenfyzhong/cityhash"
+)
+
+// NewBinaryCityHash64 creates a vindex that hashes binary bits to a
+// keyspace id using CityHash64.
+func NewBinaryCityHash64(name string, _ map[string]interface{}) (Vindex, error) {
+	return &binaryHashVindex{name: name, label: "BinaryCityHash64", algo: "cityhash64"}, nil
+}
+
+func init() {
+	RegisterHashFunc("cityhash64", func(_, data []byte) []byte {
+		sum := make([]byte, 8)
+		binary.BigEndian.PutUint64(sum, cityhash.CityHash64(data, uint32(len(data))))
+		return sum
+	})
+	Register("binary_cityhash64", NewBinaryCityHash64)
+}
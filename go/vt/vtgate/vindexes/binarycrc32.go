@@ -0,0 +1,24 @@
+package vindexes
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// NewBinaryCRC32 creates a vindex that hashes binary bits to a keyspace id
+// using CRC32 (IEEE polynomial). It is the cheapest of the Binary* hash
+// vindexes, at the cost of a much higher collision rate than
+// MD5/xxHash64/CityHash64, and exists mainly for keyspaces where the input
+// cardinality is small enough that this doesn't matter.
+func NewBinaryCRC32(name string, _ map[string]interface{}) (Vindex, error) {
+	return &binaryHashVindex{name: name, label: "BinaryCRC32", algo: "crc32"}, nil
+}
+
+func init() {
+	RegisterHashFunc("crc32", func(_, data []byte) []byte {
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(data))
+		return sum
+	})
+	Register("binary_crc32", NewBinaryCRC32)
+}
@@ -0,0 +1,58 @@
+package vindexes
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// binaryHashVindex is the shared implementation behind the Binary* content
+// hash vindexes (BinaryMD5, BinaryCRC32, BinaryCityHash64, BinaryXXHash64,
+// BinaryHMACSHA256): they differ only in which HashFunc they look up and,
+// for the keyed variants, the secret passed to it, so besides the vindex
+// name and the label used in errors, that's all each one's constructor sets.
+type binaryHashVindex struct {
+	name   string
+	label  string // used in error messages, e.g. "BinaryCRC32"
+	algo   string // key into hashFuncs
+	secret []byte // nil for unkeyed algorithms
+}
+
+// String returns the name of the vindex.
+func (vind *binaryHashVindex) String() string {
+	return vind.name
+}
+
+// Cost returns the cost as 1.
+func (vind *binaryHashVindex) Cost() int {
+	return 1
+}
+
+// Verify returns true if id maps to ksid.
+func (vind *binaryHashVindex) Verify(_ VCursor, id interface{}, ksid []byte) (bool, error) {
+	data, err := vind.hashKey(id)
+	if err != nil {
+		return false, fmt.Errorf("%s.Verify: %v", vind.label, err)
+	}
+	return bytes.Compare(data, ksid) == 0, nil
+}
+
+// Map returns the corresponding keyspace id values for the given ids.
+func (vind *binaryHashVindex) Map(_ VCursor, ids []interface{}) ([][]byte, error) {
+	out := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		data, err := vind.hashKey(id)
+		if err != nil {
+			return nil, fmt.Errorf("%s.Map: %v", vind.label, err)
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+func (vind *binaryHashVindex) hashKey(key interface{}) ([]byte, error) {
+	source, err := getBytes(key)
+	if err != nil {
+		return nil, err
+	}
+	return hashFuncs[vind.algo](vind.secret, source), nil
+}
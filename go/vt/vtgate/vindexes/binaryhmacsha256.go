@@ -0,0 +1,26 @@
+package vindexes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// NewBinaryHMACSHA256 creates a vindex that hashes binary bits to a
+// keyspace id using HMAC-SHA256 keyed with the required "secret" param.
+func NewBinaryHMACSHA256(name string, m map[string]interface{}) (Vindex, error) {
+	secret, ok := m["secret"].(string)
+	if !ok || secret == "" {
+		return nil, fmt.Errorf("BinaryHMACSHA256: missing required \"secret\" param")
+	}
+	return &binaryHashVindex{name: name, label: "BinaryHMACSHA256", algo: "hmac_sha256", secret: []byte(secret)}, nil
+}
+
+func init() {
+	RegisterHashFunc("hmac_sha256", func(key, data []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return mac.Sum(nil)
+	})
+	Register("binary_hmac_sha256", NewBinaryHMACSHA256)
+}
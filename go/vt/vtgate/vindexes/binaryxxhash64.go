@@ -0,0 +1,22 @@
+package vindexes
+
+import (
+	"encoding/binary"
+
+	"github.com/cespare/xxhash"
+)
+
+// NewBinaryXXHash64 creates a vindex that hashes binary bits to a keyspace
+// id using xxHash64.
+func NewBinaryXXHash64(name string, _ map[string]interface{}) (Vindex, error) {
+	return &binaryHashVindex{name: name, label: "BinaryXXHash64", algo: "xxhash64"}, nil
+}
+
+func init() {
+	RegisterHashFunc("xxhash64", func(_, data []byte) []byte {
+		sum := make([]byte, 8)
+		binary.BigEndian.PutUint64(sum, xxhash.Sum64(data))
+		return sum
+	})
+	Register("binary_xxhash64", NewBinaryXXHash64)
+}
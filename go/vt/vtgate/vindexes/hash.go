@@ -0,0 +1,34 @@
+package vindexes
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// HashFunc computes a content hash of data. Keyed hash functions (like
+// HMAC variants) use key; unkeyed ones ignore it.
+type HashFunc func(key, data []byte) []byte
+
+var hashFuncs = make(map[string]HashFunc)
+
+// RegisterHashFunc is meant to be used by the Binary* family of vindexes
+// to self register the hash algorithm they wrap.
+func RegisterHashFunc(name string, hashFunc HashFunc) {
+	if _, ok := hashFuncs[name]; ok {
+		panic(fmt.Sprintf("HashFunc %s already registered", name))
+	}
+	hashFuncs[name] = hashFunc
+}
+
+// getBytes extracts the raw bytes to hash out of a vindex id, which is
+// either a []byte already, or a sqltypes.Value.
+func getBytes(key interface{}) ([]byte, error) {
+	switch v := key.(type) {
+	case []byte:
+		return v, nil
+	case sqltypes.Value:
+		return v.Raw(), nil
+	}
+	return nil, fmt.Errorf("unexpected data type for hash: %T", key)
+}